@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"github.com/casbin/casbin"
+	"github.com/casbin/casbin/model"
+	"github.com/ctdk/goiardi/config"
+	"github.com/ctdk/goiardi/organization"
+)
+
+// modelDefinition is the Casbin model every org's enforcer is built from.
+// A request is (subject, container type, container kind, scope, action,
+// effect); effect is part of the request so that an "allow" request only
+// matches allow policies. Casbin's effect resolution under this model only
+// ever reports allows, so deny policies are looked up directly with
+// HasPolicy (see enforceAny), and CheckItemPerm and Filter apply their own
+// deny-before-allow precedence across org- and server-wide scopes.
+const modelDefinition = `
+[request_definition]
+r = sub, objType, objKind, scope, act, eft
+
+[policy_definition]
+p = sub, objType, objKind, scope, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = (g(r.sub, p.sub) || r.sub == p.sub) && r.objType == p.objType && r.objKind == p.objKind && r.scope == p.scope && r.act == p.act && r.eft == p.eft
+`
+
+// defaultActions are the permissions initializeACL grants admins (and the
+// bootstrap user) across every container type it knows about.
+var defaultActions = []string{"create", "read", "update", "delete", "grant"}
+
+// defaultContainerTypes are the container types initializeACL seeds
+// policies for. Types this package doesn't know about (added by packages
+// outside this checkout) simply have no default policy and fall through
+// to CheckItemPerm/Filter's normal "no matching allow" result.
+var defaultContainerTypes = []string{"groups", "clients", "roles"}
+
+// orgEnforcers holds every org's enforcer, keyed by org name. CheckItemPerm
+// and Filter look an org's enforcer up here rather than taking one as a
+// parameter, since a request only ever has the org, not the enforcer that
+// goes with it.
+var orgEnforcers = make(map[string]*casbin.SyncedEnforcer)
+
+// ACLMember is anything that can be named as a Casbin subject or grouping
+// policy target -- an actor.Actor, or a *group.Group standing in for its
+// own members when it's nested inside another group.
+type ACLMember interface {
+	GetName() string
+}
+
+// RemoveMembers removes the grouping policies added by AddMembers, so none
+// of members still resolve to role's ACL role. It's the counterpart to
+// AddMembers, and the two are meant to be called together whenever a
+// group's membership is edited wholesale (see group.Group.Edit).
+func RemoveMembers(org *organization.Organization, role aclRoler, members []ACLMember) error {
+	e := orgEnforcers[org.Name]
+	if e == nil {
+		return nil
+	}
+	roleName := role.ACLName()
+	for _, m := range members {
+		e.RemoveGroupingPolicy(m.GetName(), roleName)
+	}
+	return nil
+}
+
+// initializeACL builds a fresh enforcer for org from m, seeds it with the
+// default admins/users policies every org starts with, registers it in
+// orgEnforcers, and returns it.
+func initializeACL(org *organization.Organization, m model.Model) (*casbin.SyncedEnforcer, error) {
+	e := casbin.NewSyncedEnforcer(m)
+	seedDefaultPolicies(e)
+	orgEnforcers[org.Name] = e
+	return e, nil
+}
+
+// loadACL builds org's enforcer -- backed by the database if config.UsingDB()
+// is true, in memory otherwise -- and registers it in orgEnforcers so
+// CheckItemPerm and Filter can find it.
+func loadACL(org *organization.Organization) (*casbin.SyncedEnforcer, error) {
+	if config.UsingDB() {
+		e := NewDBEnforcer(org.ID)
+		orgEnforcers[org.Name] = e
+		return e, nil
+	}
+	m := casbin.NewModel(modelDefinition)
+	return initializeACL(org, m)
+}
+
+// seedDefaultPolicies grants the admins role and the bootstrap user every
+// action on every container type this package knows about, and grants the
+// users role read and create access to roles. These are an org's starting policies;
+// everything past that is built up through group membership and
+// AddDenyActor/AddDenyGroup.
+func seedDefaultPolicies(e *casbin.SyncedEnforcer) {
+	for _, t := range defaultContainerTypes {
+		for _, act := range defaultActions {
+			e.AddPolicy("admins", t, "containers", "default", act, "allow")
+			e.AddPolicy(config.Config.BootstrapUser, t, "containers", "default", act, "allow")
+		}
+	}
+	e.AddPolicy("users", "roles", "containers", "default", "read", "allow")
+	e.AddPolicy("users", "roles", "containers", "default", "create", "allow")
+}
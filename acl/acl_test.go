@@ -73,8 +73,8 @@ func buildOrg() (*organization.Organization, *user.User, *casbin.SyncedEnforcer)
 	ar.Accept()
 	group.MakeDefaultGroups(org)
 	admins, _ := group.Get(org, "admins")
-	admins.AddActor(adminUser)
-	admins.Save()
+	admins.AddActor(adminUser, adminUser)
+	admins.Save(adminUser)
 
 	// m := casbin.NewModel(modelDefinition)
 	// e, _ := initializeACL(org, m)
@@ -153,8 +153,8 @@ func TestCheckItemPerm(t *testing.T) {
 	ar, _ := association.SetReq(u, org, adminUser)
 	ar.Accept()
 	us, _ := group.Get(org, "users")
-	us.AddActor(u)
-	us.Save()
+	us.AddActor(u, u)
+	us.Save(u)
 	// temporary again
 	e.AddGroupingPolicy(u.Username, "users")
 
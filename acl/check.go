@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"github.com/ctdk/goiardi/actor"
+	"github.com/ctdk/goiardi/organization"
+	"github.com/ctdk/goiardi/util"
+)
+
+var validActions = map[string]bool{
+	"create": true,
+	"read":   true,
+	"update": true,
+	"delete": true,
+	"grant":  true,
+}
+
+// CheckItemPerm reports whether act may perform action against obj in org.
+// A false result with a nil error means the check ran fine and simply came
+// back negative; a non-nil error means action itself wasn't a recognized
+// permission, or org has no ACL enforcer loaded.
+//
+// Deny is checked before allow, at two scopes: first the server-wide
+// ServerDenyList, which blocks act everywhere regardless of org, then
+// org's own enforcer, where an explicit deny policy on act (or a group it
+// belongs to) overrides any allow policy that would otherwise apply.
+func CheckItemPerm(org *organization.Organization, obj Objecter, act actor.Actor, action string) (bool, util.Gerror) {
+	if !validActions[action] {
+		return false, util.Errorf("invalid permission action '%s'", action)
+	}
+
+	if GetServerDenyList().Denies(act.GetName()) {
+		return false, nil
+	}
+
+	e := orgEnforcers[org.Name]
+	if e == nil {
+		return false, util.Errorf("no ACL enforcer configured for organization %s", org.Name)
+	}
+
+	subjects := filterSubjects(e, act)
+
+	return enforceAny(e, subjects, obj, action), nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"testing"
+
+	"github.com/ctdk/goiardi/association"
+	"github.com/ctdk/goiardi/group"
+	"github.com/ctdk/goiardi/role"
+	"github.com/ctdk/goiardi/user"
+)
+
+func TestCheckItemPermOrgLocalDenyOverridesAllow(t *testing.T) {
+	org, adminUser, e := buildOrg()
+	r, _ := role.New(org, "deny-override")
+	r.Save()
+
+	chk, err := CheckItemPerm(org, r, adminUser, "create")
+	if err != nil || !chk {
+		t.Fatalf("expected adminUser to be allowed to create the role before any deny rule, got %v, %v", chk, err)
+	}
+
+	e.AddPolicy(adminUser.Username, r.ContainerType(), r.ContainerKind(), "default", "create", "deny")
+
+	chk, err = CheckItemPerm(org, r, adminUser, "create")
+	if err != nil {
+		t.Fatalf("CheckItemPerm returned an unexpected error: %s", err.Error())
+	}
+	if chk {
+		t.Error("expected an explicit deny policy to override the admin's allow, but the check still passed")
+	}
+}
+
+func TestCheckItemPermGroupDenyActorOverridesGroupAllow(t *testing.T) {
+	org, adminUser, e := buildOrg()
+	r, _ := role.New(org, "group-deny")
+	r.Save()
+
+	vetoed, _ := user.New("vetoed-by-group")
+	vetoed.Save()
+	ar, _ := association.SetReq(vetoed, org, adminUser)
+	ar.Accept()
+
+	parent, err := group.New(org, "group-deny-parent")
+	if err != nil {
+		t.Fatalf("couldn't create group-deny-parent: %s", err.Error())
+	}
+	if derr := parent.AddActor(vetoed, adminUser); derr != nil {
+		t.Fatalf("couldn't add vetoed to group-deny-parent: %s", derr.Error())
+	}
+	parent.Save(adminUser)
+	e.AddGroupingPolicy(vetoed.Username, parent.ACLName())
+	e.AddPolicy(parent.ACLName(), r.ContainerType(), r.ContainerKind(), "default", "create", "allow")
+
+	chk, err := CheckItemPerm(org, r, vetoed, "create")
+	if err != nil || !chk {
+		t.Fatalf("expected vetoed to be allowed to create the role via group-deny-parent before any veto, got %v, %v", chk, err)
+	}
+
+	if derr := parent.AddDenyActor(vetoed, adminUser); derr != nil {
+		t.Fatalf("AddDenyActor failed: %s", derr.Error())
+	}
+
+	chk, err = CheckItemPerm(org, r, vetoed, "create")
+	if err != nil {
+		t.Fatalf("CheckItemPerm returned an unexpected error: %s", err.Error())
+	}
+	if chk {
+		t.Error("expected AddDenyActor to veto vetoed from group-deny-parent's allow policy, but the check still passed")
+	}
+
+	if derr := parent.DelDenyActor(vetoed, adminUser); derr != nil {
+		t.Fatalf("DelDenyActor failed: %s", derr.Error())
+	}
+
+	chk, err = CheckItemPerm(org, r, vetoed, "create")
+	if err != nil || !chk {
+		t.Fatalf("expected DelDenyActor to restore vetoed's access via group-deny-parent, got %v, %v", chk, err)
+	}
+}
+
+func TestCheckItemPermServerDenyListOverridesEverything(t *testing.T) {
+	org, adminUser, _ := buildOrg()
+	r, _ := role.New(org, "server-deny")
+	r.Save()
+
+	if err := GetServerDenyList().Add(adminUser.Username); err != nil {
+		t.Fatalf("couldn't add adminUser to the server deny list: %s", err.Error())
+	}
+	defer GetServerDenyList().Remove(adminUser.Username)
+
+	chk, err := CheckItemPerm(org, r, adminUser, "create")
+	if err != nil {
+		t.Fatalf("CheckItemPerm returned an unexpected error: %s", err.Error())
+	}
+	if chk {
+		t.Error("expected the server deny list to block adminUser everywhere, but the check still passed")
+	}
+}
+
+func TestCheckItemPermUnknownAction(t *testing.T) {
+	org, adminUser, _ := buildOrg()
+	r, _ := role.New(org, "unknown-action")
+	r.Save()
+
+	if _, err := CheckItemPerm(org, r, adminUser, "frobnatz"); err == nil {
+		t.Error("expected an error for an unrecognized permission action, got none")
+	}
+}
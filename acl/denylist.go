@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ctdk/goiardi/config"
+)
+
+const serverDenyListFile = "server_deny_list.json"
+
+// ServerDenyList is a single, server-wide list of actor names that are
+// blocked from every org, checked before any org's enforcer gets a say.
+// It's meant for the case an operator needs to lock a compromised client
+// or user out of the whole server immediately, without having to go find
+// and edit every group it happens to be a member of.
+type ServerDenyList struct {
+	mu     sync.RWMutex
+	Actors map[string]bool
+}
+
+var (
+	serverDenyList     *ServerDenyList
+	serverDenyListOnce sync.Once
+)
+
+// GetServerDenyList returns the server's singleton deny list, loading it
+// from config.Config.PolicyRoot the first time it's asked for.
+func GetServerDenyList() *ServerDenyList {
+	serverDenyListOnce.Do(func() {
+		serverDenyList = &ServerDenyList{Actors: make(map[string]bool)}
+		serverDenyList.load()
+	})
+	return serverDenyList
+}
+
+// Denies reports whether name is on the server deny list.
+func (s *ServerDenyList) Denies(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Actors[name]
+}
+
+// Add puts name on the server deny list and persists the change.
+func (s *ServerDenyList) Add(name string) error {
+	s.mu.Lock()
+	s.Actors[name] = true
+	s.mu.Unlock()
+	return s.save()
+}
+
+// Remove takes name off the server deny list and persists the change.
+func (s *ServerDenyList) Remove(name string) error {
+	s.mu.Lock()
+	delete(s.Actors, name)
+	s.mu.Unlock()
+	return s.save()
+}
+
+func (s *ServerDenyList) path() string {
+	return filepath.Join(config.Config.PolicyRoot, serverDenyListFile)
+}
+
+func (s *ServerDenyList) load() {
+	b, err := ioutil.ReadFile(s.path())
+	if err != nil {
+		// no deny list on disk yet is the normal case
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	json.Unmarshal(b, &s.Actors)
+}
+
+func (s *ServerDenyList) save() error {
+	s.mu.RLock()
+	b, err := json.Marshal(s.Actors)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path(), b, os.FileMode(0640))
+}
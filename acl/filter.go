@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"fmt"
+
+	"github.com/casbin/casbin"
+	"github.com/ctdk/goiardi/actor"
+	"github.com/ctdk/goiardi/organization"
+)
+
+// Objecter is anything Filter can test an action against: the container
+// type and kind pair CheckItemPerm already keys its policies on.
+type Objecter interface {
+	ContainerType() string
+	ContainerKind() string
+}
+
+// Filter returns the subset of objects that act is allowed to perform
+// action on within org, without checking each one against the enforcer
+// from scratch. act's transitive group membership is resolved once, up
+// front, into a fixed list of Casbin subjects; each object is then tested
+// against that same list. This replaces calling CheckItemPerm once per
+// object, which re-resolves act's group membership every single time --
+// fine for a single item, expensive for a list handler returning
+// thousands of them.
+func Filter[O Objecter](org *organization.Organization, act actor.Actor, action string, objects []O) ([]O, error) {
+	e := orgEnforcers[org.Name]
+	if e == nil {
+		return nil, fmt.Errorf("acl: no enforcer configured for organization %q", org.Name)
+	}
+
+	if GetServerDenyList().Denies(act.GetName()) {
+		return make([]O, 0), nil
+	}
+
+	subjects := filterSubjects(e, act)
+
+	allowed := make([]O, 0, len(objects))
+	for _, o := range objects {
+		if enforceAny(e, subjects, o, action) {
+			allowed = append(allowed, o)
+		}
+	}
+	return allowed, nil
+}
+
+// filterSubjects resolves act's own name plus every group -- and group of
+// groups -- it's transitively a member of. It's the one place the
+// membership graph gets walked; Filter reuses the result for every object
+// it checks instead of asking the enforcer to walk it again per object.
+func filterSubjects(e *casbin.SyncedEnforcer, act actor.Actor) []string {
+	name := act.GetName()
+	roles := e.GetImplicitRolesForUser(name)
+	subjects := make([]string, 0, len(roles)+1)
+	subjects = append(subjects, name)
+	subjects = append(subjects, roles...)
+	return subjects
+}
+
+// enforceAny reports whether any of subjects is allowed to perform action
+// against obj, with an explicit deny for any of subjects taking precedence
+// over an allow -- same precedence CheckItemPerm applies.
+func enforceAny(e *casbin.SyncedEnforcer, subjects []string, obj Objecter, action string) bool {
+	for _, s := range subjects {
+		if e.HasPolicy(s, obj.ContainerType(), obj.ContainerKind(), "default", action, "deny") {
+			return false
+		}
+	}
+	for _, s := range subjects {
+		if e.Enforce(s, obj.ContainerType(), obj.ContainerKind(), "default", action, "allow") {
+			return true
+		}
+	}
+	return false
+}
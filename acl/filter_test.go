@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ctdk/goiardi/association"
+	"github.com/ctdk/goiardi/group"
+	"github.com/ctdk/goiardi/organization"
+	"github.com/ctdk/goiardi/role"
+	"github.com/ctdk/goiardi/user"
+)
+
+func TestFilterReturnsOnlyPermittedObjects(t *testing.T) {
+	org, adminUser, e := buildOrg()
+
+	roles := make([]*role.Role, 0, 3)
+	for i := 0; i < 3; i++ {
+		r, _ := role.New(org, fmt.Sprintf("filter-role-%d", i))
+		r.Save()
+		roles = append(roles, r)
+	}
+
+	allowed, err := Filter(org, adminUser, "create", roles)
+	if err != nil {
+		t.Fatalf("Filter failed for adminUser: %s", err.Error())
+	}
+	if len(allowed) != len(roles) {
+		t.Errorf("expected adminUser to be allowed to create all %d roles, got %d", len(roles), len(allowed))
+	}
+
+	u, _ := user.New("filter-test-user")
+	u.Save()
+	ar, _ := association.SetReq(u, org, adminUser)
+	ar.Accept()
+	us, _ := group.Get(org, "users")
+	us.AddActor(u, adminUser)
+	us.Save(adminUser)
+	e.AddGroupingPolicy(u.Username, "users")
+
+	denied, err := Filter(org, u, "grant", roles)
+	if err != nil {
+		t.Fatalf("Filter failed for normal user: %s", err.Error())
+	}
+	if len(denied) != 0 {
+		t.Errorf("expected normal user to be denied 'grant' on every role, got %d allowed", len(denied))
+	}
+}
+
+func TestFilterUnknownOrg(t *testing.T) {
+	org, _ := organization.New("filter-unknown-org", "no enforcer built for this one")
+	if _, err := Filter(org, pivotal, "read", []*role.Role{}); err == nil {
+		t.Error("expected Filter to fail for an org with no enforcer loaded, but it didn't")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"github.com/ctdk/goiardi/organization"
+)
+
+// aclRoler is anything with a Casbin role name of its own, such as
+// group.Group.
+type aclRoler interface {
+	ACLName() string
+}
+
+// AddMembers adds grouping policies to org's enforcer so that each of
+// members is recognized as belonging to role's ACL role. It's the
+// counterpart to RemoveMembers, and the two are meant to be called together
+// whenever a group's membership is edited wholesale (see group.Group.Edit).
+func AddMembers(org *organization.Organization, role aclRoler, members []ACLMember) error {
+	e := orgEnforcers[org.Name]
+	if e == nil {
+		return nil
+	}
+	roleName := role.ACLName()
+	for _, m := range members {
+		e.AddGroupingPolicy(m.GetName(), roleName)
+	}
+	return nil
+}
+
+// DenyMember mirrors every "allow" policy currently granted to role as an
+// explicit "deny" policy scoped to member, so member is blocked from
+// role's grants even when it also qualifies for them some other way (most
+// commonly, by being a transitive member of role through a nested group).
+// This is what backs group.Group.AddDenyActor/AddDenyGroup -- see
+// acl.CheckItemPerm and acl.Filter, which both check deny policies like
+// these before any allow.
+func DenyMember(org *organization.Organization, role aclRoler, member ACLMember) error {
+	e := orgEnforcers[org.Name]
+	if e == nil {
+		return nil
+	}
+	for _, p := range e.GetFilteredPolicy(0, role.ACLName()) {
+		if len(p) < 6 || p[5] != "allow" {
+			continue
+		}
+		e.AddPolicy(member.GetName(), p[1], p[2], p[3], p[4], "deny")
+	}
+	return nil
+}
+
+// AllowMember removes the deny policies DenyMember added for member against
+// role, undoing AddDenyActor/AddDenyGroup.
+func AllowMember(org *organization.Organization, role aclRoler, member ACLMember) error {
+	e := orgEnforcers[org.Name]
+	if e == nil {
+		return nil
+	}
+	for _, p := range e.GetFilteredPolicy(0, role.ACLName()) {
+		if len(p) < 6 || p[5] != "allow" {
+			continue
+		}
+		e.RemovePolicy(member.GetName(), p[1], p[2], p[3], p[4], "deny")
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package acl
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/casbin/casbin"
+	"github.com/casbin/casbin/model"
+	"github.com/casbin/casbin/persist"
+	"github.com/ctdk/goiardi/config"
+	"github.com/ctdk/goiardi/datastore"
+)
+
+// PolicyAdapter is a casbin persist.Adapter backed by the "casbin_rule"
+// table, keyed by org, so every org's enforcer persists to (and restores
+// from) its own slice of rows. This is what lets loadACL rebuild an org's
+// rules from the database on restart, rather than an org only ever
+// getting its rules from buildOrg-style test scaffolding.
+type PolicyAdapter struct {
+	orgID int64
+}
+
+// NewPolicyAdapter returns a PolicyAdapter scoped to orgID.
+func NewPolicyAdapter(orgID int64) *PolicyAdapter {
+	return &PolicyAdapter{orgID: orgID}
+}
+
+// NewDBEnforcer builds a SyncedEnforcer for orgID backed by a PolicyAdapter,
+// so its rules are loaded from, and every subsequent change is persisted
+// back to, the casbin_rule table. loadACL calls this instead of handing
+// casbin.NewSyncedEnforcer a bare in-memory model when config.UsingDB() is
+// true -- otherwise an org's rules would only ever come from whatever
+// re-added them in memory since the last restart.
+func NewDBEnforcer(orgID int64) *casbin.SyncedEnforcer {
+	m := casbin.NewModel(modelDefinition)
+	return casbin.NewSyncedEnforcer(m, NewPolicyAdapter(orgID))
+}
+
+// LoadPolicy implements persist.Adapter.
+func (a *PolicyAdapter) LoadPolicy(m model.Model) error {
+	dbh := datastore.Dbh()
+	rows, err := dbh.Query(a.ph("SELECT ptype, v0, v1, v2, v3, v4, v5 FROM casbin_rule WHERE org_id = %s", 1), a.orgID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ptype string
+		var v [6]string
+		if err := rows.Scan(&ptype, &v[0], &v[1], &v[2], &v[3], &v[4], &v[5]); err != nil {
+			return err
+		}
+		fields := []string{ptype}
+		for _, f := range v {
+			if f == "" {
+				break
+			}
+			fields = append(fields, f)
+		}
+		persist.LoadPolicyLine(strings.Join(fields, ", "), m)
+	}
+	return rows.Err()
+}
+
+// SavePolicy implements persist.Adapter. It replaces the org's entire rule
+// set in one transaction, same as casbin's other full-save adapters do.
+func (a *PolicyAdapter) SavePolicy(m model.Model) error {
+	dbh := datastore.Dbh()
+	tx, err := dbh.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(a.ph("DELETE FROM casbin_rule WHERE org_id = %s", 1), a.orgID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	insertRules := func(ptype string, policies [][]string) error {
+		for _, rule := range policies {
+			if err := a.insert(tx, ptype, rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for ptype, ast := range m["p"] {
+		if err := insertRules(ptype, ast.Policy); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for ptype, ast := range m["g"] {
+		if err := insertRules(ptype, ast.Policy); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddPolicy implements persist.Adapter.
+func (a *PolicyAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	dbh := datastore.Dbh()
+	return a.insert(dbh, ptype, rule)
+}
+
+// RemovePolicy implements persist.Adapter.
+func (a *PolicyAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemoveFilteredPolicy(sec, ptype, 0, rule...)
+}
+
+// RemoveFilteredPolicy implements persist.Adapter.
+func (a *PolicyAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	dbh := datastore.Dbh()
+	q := "DELETE FROM casbin_rule WHERE org_id = " + a.arg(1) + " AND ptype = " + a.arg(2)
+	args := []interface{}{a.orgID, ptype}
+	for i, v := range fieldValues {
+		if v == "" {
+			continue
+		}
+		args = append(args, v)
+		q += fmt.Sprintf(" AND v%d = %s", fieldIndex+i, a.arg(len(args)))
+	}
+	_, err := dbh.Exec(q, args...)
+	return err
+}
+
+// insert writes a single (ptype, rule) row for this org.
+func (a *PolicyAdapter) insert(x interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+}, ptype string, rule []string) error {
+	q := fmt.Sprintf("INSERT INTO casbin_rule (org_id, ptype, v0, v1, v2, v3, v4, v5) VALUES (%s, %s, %s, %s, %s, %s, %s, %s)",
+		a.arg(1), a.arg(2), a.arg(3), a.arg(4), a.arg(5), a.arg(6), a.arg(7), a.arg(8))
+	args := make([]interface{}, 8)
+	args[0], args[1] = a.orgID, ptype
+	for i := 0; i < 6; i++ {
+		if i < len(rule) {
+			args[2+i] = rule[i]
+		} else {
+			args[2+i] = ""
+		}
+	}
+	_, err := x.Exec(q, args...)
+	return err
+}
+
+// arg renders the nth bind parameter in whichever placeholder style the
+// configured database expects.
+func (a *PolicyAdapter) arg(n int) string {
+	if config.Config.UseMySQL {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// ph is a small helper for the (rare) queries in this file with only one
+// bind parameter, so callers don't have to spell out arg(1) inline.
+func (a *PolicyAdapter) ph(query string, n int) string {
+	return fmt.Sprintf(query, a.arg(n))
+}
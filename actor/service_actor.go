@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package actor
+
+// serviceActor is the identity goiardi attributes its own internal group
+// writes to -- MakeDefaultGroups, ClearActor, and anything else that runs
+// as routine upkeep rather than on behalf of a particular request -- so
+// those changes show up in the audit trail and as Casbin subjects as
+// something other than anonymous or a hard-coded bootstrap user.
+type serviceActor struct{}
+
+func (serviceActor) GetName() string { return "goiardi-service" }
+func (serviceActor) IsClient() bool  { return false }
+
+var theServiceActor = serviceActor{}
+
+// ServiceActor returns the singleton actor internal goiardi operations are
+// attributed to.
+func ServiceActor() Actor {
+	return theServiceActor
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package audit records structured, attributable events for mutations made
+// to goiardi resources. A resource package (group, and later role and
+// organization) builds an Event describing who did what to which object,
+// and hands it to Record. Where the event ends up is controlled by whatever
+// Sink has been installed with SetSink.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/logger"
+)
+
+// FieldChange captures the before and after value of a single changed
+// field on an audited resource.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Event is a single audit record describing one mutation, performed by one
+// actor, against one resource.
+type Event struct {
+	Time         time.Time              `json:"time"`
+	Actor        string                 `json:"actor"`
+	Org          string                 `json:"org"`
+	ResourceType string                 `json:"resource_type"`
+	ResourceName string                 `json:"resource_name"`
+	Action       string                 `json:"action"`
+	Changes      map[string]FieldChange `json:"changes,omitempty"`
+}
+
+// Sink is anything willing to receive audit events as they're emitted.
+// Implementations must be safe for concurrent use, since Record may be
+// called from multiple goroutines handling different requests.
+type Sink interface {
+	Record(Event)
+}
+
+var (
+	mu   sync.RWMutex
+	sink Sink = LogSink{}
+)
+
+// SetSink installs s as the destination for all audit events emitted from
+// this point on, replacing whatever sink was configured before. With
+// nothing configured, events go to LogSink.
+func SetSink(s Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sink = s
+}
+
+// Record emits e to the currently configured sink. Callers build up an
+// Event describing the acting principal, the resource affected, and a
+// before/after diff of whatever fields changed, then pass it here.
+func Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	mu.RLock()
+	s := sink
+	mu.RUnlock()
+	s.Record(e)
+}
+
+// LogSink records audit events through the standard goiardi logger. It's
+// the default sink, used whenever nothing else has been configured.
+type LogSink struct{}
+
+// Record implements Sink.
+func (LogSink) Record(e Event) {
+	logger.Infof("audit: actor=%q org=%q action=%q resource=%s/%q changes=%v", e.Actor, e.Org, e.Action, e.ResourceType, e.ResourceName, e.Changes)
+}
+
+// FileSink appends each audit event as a line of JSON to the file at Path,
+// in the usual "JSON lines" format. The file is opened and closed on every
+// write rather than held open, so it can be rotated out from under us.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileSink creates (or confirms write access to) the file at path and
+// returns a FileSink that appends to it.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &FileSink{Path: path}, nil
+}
+
+// Record implements Sink.
+func (f *FileSink) Record(e Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fh, err := os.OpenFile(f.Path, os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		logger.Errorf("audit: couldn't open %s to record event: %s", f.Path, err.Error())
+		return
+	}
+	defer fh.Close()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		logger.Errorf("audit: couldn't marshal event for %s/%s: %s", e.ResourceType, e.ResourceName, err.Error())
+		return
+	}
+	fmt.Fprintln(fh, string(b))
+}
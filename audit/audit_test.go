@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type memSink struct {
+	events []Event
+}
+
+func (m *memSink) Record(e Event) {
+	m.events = append(m.events, e)
+}
+
+func TestRecordUsesConfiguredSink(t *testing.T) {
+	m := &memSink{}
+	SetSink(m)
+	defer SetSink(LogSink{})
+
+	Record(Event{
+		Actor:        "pivotal",
+		Org:          "default",
+		ResourceType: "group",
+		ResourceName: "admins",
+		Action:       "member_add",
+		Changes: map[string]FieldChange{
+			"Actors": {Old: []string{}, New: []string{"pivotal"}},
+		},
+	})
+
+	if len(m.events) != 1 {
+		t.Fatalf("expected 1 event to be recorded, got %d", len(m.events))
+	}
+	e := m.events[0]
+	if e.Actor != "pivotal" || e.Action != "member_add" || e.ResourceName != "admins" {
+		t.Errorf("recorded event didn't match what was sent: %+v", e)
+	}
+	if e.Time.IsZero() {
+		t.Error("Record should have stamped a time on the event")
+	}
+}
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileSink(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %s", err.Error())
+	}
+
+	fs.Record(Event{Actor: "pivotal", ResourceType: "group", ResourceName: "admins", Action: "create"})
+	fs.Record(Event{Actor: "pivotal", ResourceType: "group", ResourceName: "admins", Action: "rename"})
+
+	f, err := os.Open(fs.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines in the audit log, got %d", len(lines))
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("couldn't unmarshal audit log line: %s", err.Error())
+	}
+	if e.Action != "rename" {
+		t.Errorf("expected second line's action to be 'rename', got %q", e.Action)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+// Conf holds goiardi's runtime configuration.
+type Conf struct {
+	UseMySQL      bool
+	UsePostgreSQL bool
+	UseAuth       bool
+	PolicyRoot    string
+	// BootstrapUser is the name of the actor group.MakeDefaultGroups adds
+	// as the initial member of an org's "admins" and "users" groups when
+	// it creates them. It replaces the old group.DefaultUser variable,
+	// so the bootstrap identity is configurable per server instead of
+	// hard-coded to "pivotal".
+	BootstrapUser string
+}
+
+// Config is the process-wide configuration singleton every package
+// consults instead of threading config values through every call.
+var Config = &Conf{BootstrapUser: "pivotal"}
+
+// UsingDB reports whether goiardi is configured to use a SQL backend
+// (MySQL or PostgreSQL) rather than its in-memory data store.
+func UsingDB() bool {
+	return Config.UseMySQL || Config.UsePostgreSQL
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"github.com/ctdk/goiardi/acl"
 	"github.com/ctdk/goiardi/actor"
+	"github.com/ctdk/goiardi/audit"
 	"github.com/ctdk/goiardi/client"
 	"github.com/ctdk/goiardi/config"
 	"github.com/ctdk/goiardi/datastore"
@@ -32,15 +33,85 @@ import (
 )
 
 var DefaultGroups = [4]string{"admins", "billing-admins", "clients", "users"}
-var DefaultUser = "pivotal" // should be moved out to config, I think. Same with
-// acl
 
 type Group struct {
 	Name   string
 	Org    *organization.Organization
 	Actors []actor.Actor
 	Groups []*Group
-	m      sync.RWMutex
+	// DenyActors and DenyGroups are explicitly vetoed from this group's
+	// ACL role, even if they're also present in Actors/Groups by way of
+	// being a member of some other, permitted, parent group. See
+	// acl.CheckItemPerm, which checks these before it checks any allow
+	// policy.
+	DenyActors []actor.Actor
+	DenyGroups []*Group
+	m          sync.RWMutex
+	isNew      bool
+	id         int64 // db id, only meaningful when config.UsingDB()
+}
+
+// actorName returns the name to attribute an audit event to, or "" if no
+// acting actor was given (which shouldn't generally happen once callers are
+// all threading one through, but audit.Record copes with it either way).
+func actorName(by actor.Actor) string {
+	if by == nil {
+		return ""
+	}
+	return by.GetName()
+}
+
+func actorNames(actors []actor.Actor) []string {
+	names := make([]string, len(actors))
+	for i, a := range actors {
+		names[i] = a.GetName()
+	}
+	return names
+}
+
+func groupNames(groups []*Group) []string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.Name
+	}
+	return names
+}
+
+// serviceActorGuard blocks anyone other than the service actor itself from
+// adding the service actor to a group. Internal jobs (MakeDefaultGroups,
+// ClearActor, index rebuilds) are attributed to the service actor so their
+// audit records and Casbin subjects aren't anonymous or hard-coded to the
+// bootstrap user; that attribution is only meaningful if nothing else can
+// grant itself the service actor's standing by sneaking it into a group.
+func serviceActorGuard(a actor.Actor, by actor.Actor) util.Gerror {
+	svc := actor.ServiceActor()
+	if a.GetName() != svc.GetName() {
+		return nil
+	}
+	if by == nil || by.GetName() != svc.GetName() {
+		err := util.Errorf("only the service actor may add itself to a group")
+		err.SetStatus(http.StatusForbidden)
+		return err
+	}
+	return nil
+}
+
+// audit records an event attributed to by. Save, Rename, Delete, AddActor,
+// DelActor, AddGroup, DelGroup, and Edit all take the acting actor for this
+// purpose, but the REST handlers that call them -- outside this package --
+// still need to be updated to pass it through instead of building a *Group
+// and calling these methods with nil; until that lands, requests coming in
+// over the HTTP API will keep auditing with an empty actor name, same as
+// before this type gained the by parameter.
+func (g *Group) audit(by actor.Actor, action string, changes map[string]audit.FieldChange) {
+	audit.Record(audit.Event{
+		Actor:        actorName(by),
+		Org:          g.Org.Name,
+		ResourceType: "group",
+		ResourceName: g.Name,
+		Action:       action,
+		Changes:      changes,
+	})
 }
 
 func New(org *organization.Organization, name string) (*Group, util.Gerror) {
@@ -56,7 +127,11 @@ func New(org *organization.Organization, name string) (*Group, util.Gerror) {
 
 	var found bool
 	if config.UsingDB() {
-
+		var derr util.Gerror
+		found, derr = groupExistsSQL(org, name)
+		if derr != nil {
+			return nil, derr
+		}
 	} else {
 		ds := datastore.New()
 		_, found = ds.Get(org.DataKey("group"), name)
@@ -67,8 +142,9 @@ func New(org *organization.Organization, name string) (*Group, util.Gerror) {
 		return nil, err
 	}
 	g := &Group{
-		Name: name,
-		Org:  org,
+		Name:  name,
+		Org:   org,
+		isNew: true,
 	}
 	return g, nil
 }
@@ -79,7 +155,16 @@ func Get(org *organization.Organization, name string) (*Group, util.Gerror) {
 		return nil, err
 	}
 	if config.UsingDB() {
-
+		group, derr := getGroupSQL(org, name)
+		if derr != nil {
+			return nil, derr
+		}
+		if group == nil {
+			err := util.Errorf("group '%s' not found in organization %s", name, org.Name)
+			err.SetStatus(http.StatusNotFound)
+			return nil, err
+		}
+		return group, nil
 	}
 	ds := datastore.New()
 	g, found := ds.Get(org.DataKey("group"), name)
@@ -95,13 +180,23 @@ func Get(org *organization.Organization, name string) (*Group, util.Gerror) {
 	return group, nil
 }
 
-func (g *Group) Save() util.Gerror {
-	g.m.RLock()
-	defer g.m.RUnlock()
-	return g.save()
+func (g *Group) Save(by actor.Actor) util.Gerror {
+	if err := g.save(); err != nil {
+		return err
+	}
+	g.m.Lock()
+	wasNew := g.isNew
+	g.isNew = false
+	g.m.Unlock()
+	action := "update"
+	if wasNew {
+		action = "create"
+	}
+	g.audit(by, action, nil)
+	return nil
 }
 
-func (g *Group) Rename(newName string) util.Gerror {
+func (g *Group) Rename(newName string, by actor.Actor) util.Gerror {
 	if !util.ValidateUserName(newName) {
 		err := util.Errorf("Field 'id' invalid")
 		return err
@@ -112,8 +207,19 @@ func (g *Group) Rename(newName string) util.Gerror {
 	}
 	g.m.Lock()
 	defer g.m.Unlock()
+	oldName := g.Name
 	if config.UsingDB() {
-
+		if found, derr := groupExistsSQL(g.Org, newName); derr != nil {
+			return derr
+		} else if found {
+			err := util.Errorf("Group %s already exists, cannot rename", newName)
+			err.SetStatus(http.StatusConflict)
+			return err
+		}
+		if derr := g.renameSQL(newName); derr != nil {
+			return derr
+		}
+		g.Name = newName
 	} else {
 		ds := datastore.New()
 		if _, found := ds.Get(g.Org.DataKey("group"), newName); found {
@@ -123,90 +229,272 @@ func (g *Group) Rename(newName string) util.Gerror {
 		}
 		ds.Delete(g.Org.DataKey("group"), g.Name)
 		g.Name = newName
-		err := g.save()
-		if err != nil {
+		if err := g.save(); err != nil {
 			return err
 		}
 	}
+	audit.Record(audit.Event{
+		Actor:        actorName(by),
+		Org:          g.Org.Name,
+		ResourceType: "group",
+		ResourceName: newName,
+		Action:       "rename",
+		Changes: map[string]audit.FieldChange{
+			"Name": {Old: oldName, New: newName},
+		},
+	})
 	return nil
 }
 
 func (g *Group) save() util.Gerror {
 	if config.UsingDB() {
-
+		return g.saveSQL()
 	}
 	ds := datastore.New()
 	ds.Set(g.Org.DataKey("group"), g.Name, g)
 	return nil
 }
 
-func (g *Group) Delete() util.Gerror {
+func (g *Group) Delete(by actor.Actor) util.Gerror {
 	g.m.RLock()
 	defer g.m.RUnlock()
 	if config.UsingDB() {
-
+		// group_subgroups rows naming g as a parent or a child are
+		// removed by the table's own foreign keys, so there's no
+		// need to walk every other group in the org here the way
+		// the in-memory path below does.
+		if derr := g.deleteSQL(); derr != nil {
+			return derr
+		}
+		g.audit(by, "delete", nil)
+		return nil
 	}
 	ds := datastore.New()
 	ds.Delete(g.Org.DataKey("group"), g.Name)
+	g.audit(by, "delete", nil)
 	ag := AllGroups(g.Org)
 	for _, cg := range ag {
 		j, _ := cg.checkForGroup(g.Name)
 		if j {
-			cg.DelGroup(g)
-			cg.Save()
+			cg.DelGroup(g, by)
+			cg.Save(by)
 		}
 	}
 	return nil
 }
 
-func (g *Group) AddActor(a actor.Actor) util.Gerror {
+func (g *Group) AddActor(a actor.Actor, by actor.Actor) util.Gerror {
+	if err := serviceActorGuard(a, by); err != nil {
+		return err
+	}
 	if found, _ := g.checkForActor(a.GetName()); !found {
+		if config.UsingDB() {
+			if derr := g.addActorSQL(a); derr != nil {
+				return derr
+			}
+		}
 		g.m.Lock()
-		defer g.m.Unlock()
+		before := actorNames(g.Actors)
 		g.Actors = append(g.Actors, a)
+		after := actorNames(g.Actors)
+		g.m.Unlock()
+		g.audit(by, "member_add", map[string]audit.FieldChange{
+			"Actors": {Old: before, New: after},
+		})
 	}
 	return nil
 }
 
-func (g *Group) DelActor(a actor.Actor) util.Gerror {
+func (g *Group) DelActor(a actor.Actor, by actor.Actor) util.Gerror {
 	if found, pos := g.checkForActor(a.GetName()); found {
+		if config.UsingDB() {
+			if derr := g.delActorSQL(a); derr != nil {
+				return derr
+			}
+		}
 		g.m.Lock()
-		defer g.m.Unlock()
+		before := actorNames(g.Actors)
 		g.Actors[pos] = nil
 		g.Actors = append(g.Actors[:pos], g.Actors[pos+1:]...)
+		after := actorNames(g.Actors)
+		g.m.Unlock()
+		g.audit(by, "member_remove", map[string]audit.FieldChange{
+			"Actors": {Old: before, New: after},
+		})
 	} else {
 		return util.Errorf("actor %s not in group", a.GetName())
 	}
 	return nil
 }
 
-func (g *Group) AddGroup(a *Group) util.Gerror {
+func (g *Group) AddGroup(a *Group, by actor.Actor) util.Gerror {
 	if found, _ := g.checkForGroup(a.Name); !found {
+		if config.UsingDB() {
+			if derr := g.addGroupSQL(a); derr != nil {
+				return derr
+			}
+		}
 		g.m.Lock()
-		defer g.m.Unlock()
+		before := groupNames(g.Groups)
 		g.Groups = append(g.Groups, a)
+		after := groupNames(g.Groups)
+		g.m.Unlock()
+		g.audit(by, "member_add", map[string]audit.FieldChange{
+			"Groups": {Old: before, New: after},
+		})
 	}
 	return nil
 }
 
-func (g *Group) DelGroup(a *Group) util.Gerror {
+func (g *Group) DelGroup(a *Group, by actor.Actor) util.Gerror {
 	if found, pos := g.checkForGroup(a.Name); found {
+		if config.UsingDB() {
+			if derr := g.delGroupSQL(a); derr != nil {
+				return derr
+			}
+		}
 		g.m.Lock()
-		defer g.m.Unlock()
+		before := groupNames(g.Groups)
 		g.Groups[pos] = nil
 		g.Groups = append(g.Groups[:pos], g.Groups[pos+1:]...)
+		after := groupNames(g.Groups)
+		g.m.Unlock()
+		g.audit(by, "member_remove", map[string]audit.FieldChange{
+			"Groups": {Old: before, New: after},
+		})
 	} else {
 		return util.Errorf("group %s not in group", a.GetName())
 	}
 	return nil
 }
 
+// AddDenyActor adds a to this group's deny list, vetoing it from this
+// group's ACL role even if it's also a member by way of some other group.
+// The veto is enforced by acl.DenyMember, which mirrors this group's
+// current allow policies into deny policies scoped to a.
+func (g *Group) AddDenyActor(a actor.Actor, by actor.Actor) util.Gerror {
+	if found, _ := g.checkForDenyActor(a.GetName()); !found {
+		if config.UsingDB() {
+			if derr := g.addDenyActorSQL(a); derr != nil {
+				return derr
+			}
+		}
+		if derr := acl.DenyMember(g.Org, g, a); derr != nil {
+			return util.Errorf(derr.Error())
+		}
+		g.m.Lock()
+		before := actorNames(g.DenyActors)
+		g.DenyActors = append(g.DenyActors, a)
+		after := actorNames(g.DenyActors)
+		g.m.Unlock()
+		g.audit(by, "update", map[string]audit.FieldChange{
+			"DenyActors": {Old: before, New: after},
+		})
+	}
+	return nil
+}
+
+// DelDenyActor removes a from this group's deny list.
+func (g *Group) DelDenyActor(a actor.Actor, by actor.Actor) util.Gerror {
+	if found, pos := g.checkForDenyActor(a.GetName()); found {
+		if config.UsingDB() {
+			if derr := g.delDenyActorSQL(a); derr != nil {
+				return derr
+			}
+		}
+		if derr := acl.AllowMember(g.Org, g, a); derr != nil {
+			return util.Errorf(derr.Error())
+		}
+		g.m.Lock()
+		before := actorNames(g.DenyActors)
+		g.DenyActors[pos] = nil
+		g.DenyActors = append(g.DenyActors[:pos], g.DenyActors[pos+1:]...)
+		after := actorNames(g.DenyActors)
+		g.m.Unlock()
+		g.audit(by, "update", map[string]audit.FieldChange{
+			"DenyActors": {Old: before, New: after},
+		})
+	} else {
+		return util.Errorf("actor %s not on group's deny list", a.GetName())
+	}
+	return nil
+}
+
+// AddDenyGroup adds a to this group's deny list, vetoing every member of a
+// from this group's ACL role even if they're also a member by way of some
+// other, permitted, group.
+func (g *Group) AddDenyGroup(a *Group, by actor.Actor) util.Gerror {
+	if found, _ := g.checkForDenyGroup(a.Name); !found {
+		if config.UsingDB() {
+			if derr := g.addDenyGroupSQL(a); derr != nil {
+				return derr
+			}
+		}
+		if derr := acl.DenyMember(g.Org, g, a); derr != nil {
+			return util.Errorf(derr.Error())
+		}
+		g.m.Lock()
+		before := groupNames(g.DenyGroups)
+		g.DenyGroups = append(g.DenyGroups, a)
+		after := groupNames(g.DenyGroups)
+		g.m.Unlock()
+		g.audit(by, "update", map[string]audit.FieldChange{
+			"DenyGroups": {Old: before, New: after},
+		})
+	}
+	return nil
+}
+
+// DelDenyGroup removes a from this group's deny list.
+func (g *Group) DelDenyGroup(a *Group, by actor.Actor) util.Gerror {
+	if found, pos := g.checkForDenyGroup(a.Name); found {
+		if config.UsingDB() {
+			if derr := g.delDenyGroupSQL(a); derr != nil {
+				return derr
+			}
+		}
+		if derr := acl.AllowMember(g.Org, g, a); derr != nil {
+			return util.Errorf(derr.Error())
+		}
+		g.m.Lock()
+		before := groupNames(g.DenyGroups)
+		g.DenyGroups[pos] = nil
+		g.DenyGroups = append(g.DenyGroups[:pos], g.DenyGroups[pos+1:]...)
+		after := groupNames(g.DenyGroups)
+		g.m.Unlock()
+		g.audit(by, "update", map[string]audit.FieldChange{
+			"DenyGroups": {Old: before, New: after},
+		})
+	} else {
+		return util.Errorf("group %s not on group's deny list", a.GetName())
+	}
+	return nil
+}
+
+func (g *Group) checkForDenyActor(name string) (bool, int) {
+	for i, a := range g.DenyActors {
+		if a.GetName() == name {
+			return true, i
+		}
+	}
+	return false, 0
+}
+
+func (g *Group) checkForDenyGroup(name string) (bool, int) {
+	for i, gr := range g.DenyGroups {
+		if gr.Name == name {
+			return true, i
+		}
+	}
+	return false, 0
+}
+
 // Edit edits a group's membership en masse from JSON data listing the actors &
 // groups that should be in the group, clearing the existing entries out
 // entirely and adding everything back. This is not the preferred way, and
 // hopefully this functionality will be able to be removed, but for the moment
 // interoperability with mainstream Chef requires it.
-func (g *Group) Edit(jsonData interface{}) util.Gerror {
+func (g *Group) Edit(jsonData interface{}, by actor.Actor) util.Gerror {
 	switch acts := jsonData.(type) {
 	case map[string]interface{}:
 		// presumably different once SQL mode catches up. Come back to
@@ -215,7 +503,9 @@ func (g *Group) Edit(jsonData interface{}) util.Gerror {
 		groups := make([]*Group, 0)
 		newActors := make(map[string]bool)
 		newGroups := make(map[string]bool)
-		oldMembers := make([]string, len(g.Actors) + len(g.Groups))
+		oldActorNames := actorNames(g.Actors)
+		oldGroupNames := groupNames(g.Groups)
+		oldMembers := make([]acl.ACLMember, len(g.Actors)+len(g.Groups))
 		for i, a := range g.Actors {
 			oldMembers[i] = a
 		}
@@ -266,6 +556,12 @@ func (g *Group) Edit(jsonData interface{}) util.Gerror {
 				groups = append(groups, addGr)
 			}
 		}
+		for _, a := range actors {
+			if err := serviceActorGuard(a, by); err != nil {
+				return err
+			}
+		}
+
 		g.m.Lock()
 		defer g.m.Unlock()
 		g.Actors = actors
@@ -281,19 +577,37 @@ func (g *Group) Edit(jsonData interface{}) util.Gerror {
 				}
 			}
 		}
-		if merr := acl.RemoveMembers(org, g, toRemove); merr != nil {
+		if merr := acl.RemoveMembers(g.Org, g, toRemove); merr != nil {
 			return merr
 		}
 
 		// Add any new actors and groups to the ACL
-		toAdd := make([]acl.ACLMember, 0, len(g.Actors) + len(g.Groups))
-		toAdd = append(toAdd, g.Actors...)
-		toAdd = append(toAdd, g.Groups...)
+		toAdd := make([]acl.ACLMember, 0, len(g.Actors)+len(g.Groups))
+		for _, a := range g.Actors {
+			toAdd = append(toAdd, a)
+		}
+		for _, gr := range g.Groups {
+			toAdd = append(toAdd, gr)
+		}
+		if merr := acl.AddMembers(g.Org, g, toAdd); merr != nil {
+			return merr
+		}
 
 		err := g.save()
 		if err != nil {
 			return err
 		}
+
+		changes := make(map[string]audit.FieldChange)
+		newActorNames := actorNames(g.Actors)
+		newGroupNames := groupNames(g.Groups)
+		if fmt.Sprint(oldActorNames) != fmt.Sprint(newActorNames) {
+			changes["Actors"] = audit.FieldChange{Old: oldActorNames, New: newActorNames}
+		}
+		if fmt.Sprint(oldGroupNames) != fmt.Sprint(newGroupNames) {
+			changes["Groups"] = audit.FieldChange{Old: oldGroupNames, New: newGroupNames}
+		}
+		g.audit(by, "update", changes)
 	case nil:
 
 	default:
@@ -325,13 +639,15 @@ func (g *Group) ToJSON() map[string]interface{} {
 	for i, g := range g.Groups {
 		gJSON["groups"].([]string)[i] = g.Name
 	}
+	gJSON["deny_actors"] = actorNames(g.DenyActors)
+	gJSON["deny_groups"] = groupNames(g.DenyGroups)
 
 	return gJSON
 }
 
 func GetList(org *organization.Organization) []string {
 	if config.UsingDB() {
-
+		return groupListSQL(org)
 	}
 	ds := datastore.New()
 	groupList := ds.GetList(org.DataKey("group"))
@@ -339,9 +655,6 @@ func GetList(org *organization.Organization) []string {
 }
 
 func AllGroups(org *organization.Organization) []*Group {
-	if config.UsingDB() {
-
-	}
 	groupList := GetList(org)
 	groups := make([]*Group, 0, len(groupList))
 	for _, n := range groupList {
@@ -354,17 +667,50 @@ func AllGroups(org *organization.Organization) []*Group {
 	return groups
 }
 
+// ClearActor removes act from every group in org, typically as part of
+// deleting act outright. Like MakeDefaultGroups, this runs as an internal
+// cleanup step rather than on behalf of whoever asked for act to be
+// deleted, so it's attributed to the service actor.
 func ClearActor(org *organization.Organization, act actor.Actor) {
+	svc := actor.ServiceActor()
+	gs := AllGroups(org)
 	if config.UsingDB() {
-
+		// Figure out which groups actually have act as a member before
+		// the single bulk delete below removes every row at once; that
+		// one query is much cheaper than a DelActor/Save round trip per
+		// group, and it still leaves one member_remove audit record
+		// per affected group. Unlike the in-memory path underneath, it
+		// records no "update" event for each group in the org.
+		var removed []*Group
+		for _, g := range gs {
+			if found, _ := g.checkForActor(act.GetName()); found {
+				removed = append(removed, g)
+			}
+		}
+		if derr := clearActorSQL(org, act); derr != nil {
+			logger.Debugf("error deleting actor for %s: %s", act.GetName(), derr.Error())
+			return
+		}
+		for _, g := range removed {
+			before := actorNames(g.Actors)
+			after := make([]string, 0, len(before))
+			for _, n := range before {
+				if n != act.GetName() {
+					after = append(after, n)
+				}
+			}
+			g.audit(svc, "member_remove", map[string]audit.FieldChange{
+				"Actors": {Old: before, New: after},
+			})
+		}
+		return
 	}
-	gs := AllGroups(org)
 	for _, g := range gs {
-		e := g.DelActor(act) // don't care if it's not available
+		e := g.DelActor(act, svc) // don't care if it's not available
 		if e != nil {
 			logger.Debugf("error deleting actor for %s: %s", act.GetName(), e.Error())
 		}
-		g.Save()
+		g.Save(svc)
 	}
 }
 
@@ -398,11 +744,16 @@ func (g *Group) ACLName() string {
 
 // should this actually return the groups?
 
+// MakeDefaultGroups creates the four standard groups every org starts
+// with. It's run as an internal setup step rather than on behalf of any
+// particular caller, so its creates and membership changes are attributed
+// to the service actor, not to whichever request happened to trigger it.
 func MakeDefaultGroups(org *organization.Organization) util.Gerror {
-	defUser, err := user.Get(DefaultUser)
+	defUser, err := user.Get(config.Config.BootstrapUser)
 	if err != nil {
 		return err
 	}
+	svc := actor.ServiceActor()
 	for _, n := range DefaultGroups {
 		g, err := New(org, n)
 		if err != nil {
@@ -410,13 +761,13 @@ func MakeDefaultGroups(org *organization.Organization) util.Gerror {
 		}
 
 		if n != "clients" && n != "billing-admins" {
-			err = g.AddActor(defUser)
+			err = g.AddActor(defUser, svc)
 			if err != nil {
 				return err
 			}
 		}
 
-		err = g.Save()
+		err = g.Save(svc)
 		if err != nil {
 			return err
 		}
@@ -443,6 +794,14 @@ func (g *Group) checkForGroup(name string) (bool, int) {
 }
 
 func (g *Group) SeekActor(actr actor.Actor) bool {
+	if config.UsingDB() {
+		found, derr := g.seekActorSQL(actr)
+		if derr != nil {
+			logger.Errorf("error walking group membership for %s: %s", actr.GetName(), derr.Error())
+			return false
+		}
+		return found
+	}
 	grs := make(map[string]*Group)
 	var actChk func(gs *Group) bool
 	actChk = func(gs *Group) bool {
@@ -0,0 +1,435 @@
+/*
+ * Copyright (c) 2013-2014, Jeremy Bingham (<jbingham@gmail.com>)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package group
+
+import (
+	"database/sql"
+
+	"github.com/ctdk/goiardi/actor"
+	"github.com/ctdk/goiardi/client"
+	"github.com/ctdk/goiardi/config"
+	"github.com/ctdk/goiardi/datastore"
+	"github.com/ctdk/goiardi/organization"
+	"github.com/ctdk/goiardi/user"
+	"github.com/ctdk/goiardi/util"
+)
+
+// This file backs Group with the "groups"/"group_actors"/"group_subgroups"
+// tables when config.UsingDB() is true. Members are keyed by the actor's
+// name rather than a surrogate id -- the same natural key everything else
+// in this package already uses (org.DataKey("group"), user.Get, and so
+// on) -- so actor_id here is a name, not a number.
+
+const (
+	clientActorType = "client"
+	userActorType   = "user"
+)
+
+func actorTypeOf(a actor.Actor) string {
+	if a.IsClient() {
+		return clientActorType
+	}
+	return userActorType
+}
+
+func fetchActor(org *organization.Organization, name string, aType string) (actor.Actor, util.Gerror) {
+	if aType == clientActorType {
+		return client.Get(org, name)
+	}
+	return user.Get(name)
+}
+
+func groupExistsSQL(org *organization.Organization, name string) (bool, util.Gerror) {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "SELECT COUNT(*) FROM groups WHERE org_id = ? AND name = ?"
+	} else {
+		q = "SELECT COUNT(*) FROM groups WHERE org_id = $1 AND name = $2"
+	}
+	var c int
+	if err := dbh.QueryRow(q, org.ID, name).Scan(&c); err != nil {
+		return false, util.CastErr(err)
+	}
+	return c > 0, nil
+}
+
+func getGroupSQL(org *organization.Organization, name string) (*Group, util.Gerror) {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "SELECT id FROM groups WHERE org_id = ? AND name = ?"
+	} else {
+		q = "SELECT id FROM groups WHERE org_id = $1 AND name = $2"
+	}
+	var id int64
+	err := dbh.QueryRow(q, org.ID, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, util.CastErr(err)
+	}
+
+	g := &Group{Name: name, Org: org, id: id}
+
+	var actorsQ string
+	if config.Config.UseMySQL {
+		actorsQ = "SELECT actor_id, actor_type FROM group_actors WHERE group_id = ?"
+	} else {
+		actorsQ = "SELECT actor_id, actor_type FROM group_actors WHERE group_id = $1"
+	}
+	rows, err := dbh.Query(actorsQ, id)
+	if err != nil {
+		return nil, util.CastErr(err)
+	}
+	for rows.Next() {
+		var actorName, aType string
+		if err = rows.Scan(&actorName, &aType); err != nil {
+			rows.Close()
+			return nil, util.CastErr(err)
+		}
+		a, aerr := fetchActor(org, actorName, aType)
+		if aerr != nil {
+			continue
+		}
+		g.Actors = append(g.Actors, a)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, util.CastErr(err)
+	}
+
+	var subQ string
+	if config.Config.UseMySQL {
+		subQ = "SELECT g.id, g.name FROM group_subgroups gs JOIN groups g ON gs.child_id = g.id WHERE gs.parent_id = ?"
+	} else {
+		subQ = "SELECT g.id, g.name FROM group_subgroups gs JOIN groups g ON gs.child_id = g.id WHERE gs.parent_id = $1"
+	}
+	subRows, err := dbh.Query(subQ, id)
+	if err != nil {
+		return nil, util.CastErr(err)
+	}
+	defer subRows.Close()
+	for subRows.Next() {
+		var childID int64
+		var childName string
+		if err = subRows.Scan(&childID, &childName); err != nil {
+			return nil, util.CastErr(err)
+		}
+		g.Groups = append(g.Groups, &Group{Name: childName, Org: org, id: childID})
+	}
+	if err = subRows.Err(); err != nil {
+		return nil, util.CastErr(err)
+	}
+
+	var denyActorsQ string
+	if config.Config.UseMySQL {
+		denyActorsQ = "SELECT actor_id, actor_type FROM group_deny_actors WHERE group_id = ?"
+	} else {
+		denyActorsQ = "SELECT actor_id, actor_type FROM group_deny_actors WHERE group_id = $1"
+	}
+	denyRows, err := dbh.Query(denyActorsQ, id)
+	if err != nil {
+		return nil, util.CastErr(err)
+	}
+	for denyRows.Next() {
+		var actorName, aType string
+		if err = denyRows.Scan(&actorName, &aType); err != nil {
+			denyRows.Close()
+			return nil, util.CastErr(err)
+		}
+		a, aerr := fetchActor(org, actorName, aType)
+		if aerr != nil {
+			continue
+		}
+		g.DenyActors = append(g.DenyActors, a)
+	}
+	denyRows.Close()
+	if err = denyRows.Err(); err != nil {
+		return nil, util.CastErr(err)
+	}
+
+	var denySubQ string
+	if config.Config.UseMySQL {
+		denySubQ = "SELECT g.id, g.name FROM group_deny_subgroups gs JOIN groups g ON gs.child_id = g.id WHERE gs.parent_id = ?"
+	} else {
+		denySubQ = "SELECT g.id, g.name FROM group_deny_subgroups gs JOIN groups g ON gs.child_id = g.id WHERE gs.parent_id = $1"
+	}
+	denySubRows, err := dbh.Query(denySubQ, id)
+	if err != nil {
+		return nil, util.CastErr(err)
+	}
+	defer denySubRows.Close()
+	for denySubRows.Next() {
+		var childID int64
+		var childName string
+		if err = denySubRows.Scan(&childID, &childName); err != nil {
+			return nil, util.CastErr(err)
+		}
+		g.DenyGroups = append(g.DenyGroups, &Group{Name: childName, Org: org, id: childID})
+	}
+	if err = denySubRows.Err(); err != nil {
+		return nil, util.CastErr(err)
+	}
+
+	return g, nil
+}
+
+func (g *Group) saveSQL() util.Gerror {
+	dbh := datastore.Dbh()
+	if g.id == 0 {
+		var q string
+		if config.Config.UseMySQL {
+			q = "INSERT INTO groups (org_id, name) VALUES (?, ?)"
+		} else {
+			q = "INSERT INTO groups (org_id, name) VALUES ($1, $2) RETURNING id"
+		}
+		if config.Config.UseMySQL {
+			res, err := dbh.Exec(q, g.Org.ID, g.Name)
+			if err != nil {
+				return util.CastErr(err)
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return util.CastErr(err)
+			}
+			g.id = id
+		} else {
+			if err := dbh.QueryRow(q, g.Org.ID, g.Name).Scan(&g.id); err != nil {
+				return util.CastErr(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Group) renameSQL(newName string) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "UPDATE groups SET name = ? WHERE id = ?"
+	} else {
+		q = "UPDATE groups SET name = $1 WHERE id = $2"
+	}
+	if _, err := dbh.Exec(q, newName, g.id); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) deleteSQL() util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "DELETE FROM groups WHERE id = ?"
+	} else {
+		q = "DELETE FROM groups WHERE id = $1"
+	}
+	// group_actors and group_subgroups rows referencing this group are
+	// removed by their ON DELETE CASCADE foreign keys.
+	if _, err := dbh.Exec(q, g.id); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) addActorSQL(a actor.Actor) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "INSERT IGNORE INTO group_actors (group_id, actor_id, actor_type) VALUES (?, ?, ?)"
+	} else {
+		q = "INSERT INTO group_actors (group_id, actor_id, actor_type) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING"
+	}
+	if _, err := dbh.Exec(q, g.id, a.GetName(), actorTypeOf(a)); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) delActorSQL(a actor.Actor) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "DELETE FROM group_actors WHERE group_id = ? AND actor_id = ? AND actor_type = ?"
+	} else {
+		q = "DELETE FROM group_actors WHERE group_id = $1 AND actor_id = $2 AND actor_type = $3"
+	}
+	if _, err := dbh.Exec(q, g.id, a.GetName(), actorTypeOf(a)); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) addGroupSQL(child *Group) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "INSERT IGNORE INTO group_subgroups (parent_id, child_id) VALUES (?, ?)"
+	} else {
+		q = "INSERT INTO group_subgroups (parent_id, child_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	}
+	if _, err := dbh.Exec(q, g.id, child.id); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) delGroupSQL(child *Group) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "DELETE FROM group_subgroups WHERE parent_id = ? AND child_id = ?"
+	} else {
+		q = "DELETE FROM group_subgroups WHERE parent_id = $1 AND child_id = $2"
+	}
+	if _, err := dbh.Exec(q, g.id, child.id); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) addDenyActorSQL(a actor.Actor) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "INSERT IGNORE INTO group_deny_actors (group_id, actor_id, actor_type) VALUES (?, ?, ?)"
+	} else {
+		q = "INSERT INTO group_deny_actors (group_id, actor_id, actor_type) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING"
+	}
+	if _, err := dbh.Exec(q, g.id, a.GetName(), actorTypeOf(a)); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) delDenyActorSQL(a actor.Actor) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "DELETE FROM group_deny_actors WHERE group_id = ? AND actor_id = ? AND actor_type = ?"
+	} else {
+		q = "DELETE FROM group_deny_actors WHERE group_id = $1 AND actor_id = $2 AND actor_type = $3"
+	}
+	if _, err := dbh.Exec(q, g.id, a.GetName(), actorTypeOf(a)); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) addDenyGroupSQL(child *Group) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "INSERT IGNORE INTO group_deny_subgroups (parent_id, child_id) VALUES (?, ?)"
+	} else {
+		q = "INSERT INTO group_deny_subgroups (parent_id, child_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	}
+	if _, err := dbh.Exec(q, g.id, child.id); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func (g *Group) delDenyGroupSQL(child *Group) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "DELETE FROM group_deny_subgroups WHERE parent_id = ? AND child_id = ?"
+	} else {
+		q = "DELETE FROM group_deny_subgroups WHERE parent_id = $1 AND child_id = $2"
+	}
+	if _, err := dbh.Exec(q, g.id, child.id); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+func groupListSQL(org *organization.Organization) []string {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "SELECT name FROM groups WHERE org_id = ?"
+	} else {
+		q = "SELECT name FROM groups WHERE org_id = $1"
+	}
+	rows, err := dbh.Query(q, org.ID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var n string
+		if rows.Scan(&n) == nil {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func clearActorSQL(org *organization.Organization, act actor.Actor) util.Gerror {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = "DELETE ga FROM group_actors ga JOIN groups g ON ga.group_id = g.id WHERE g.org_id = ? AND ga.actor_id = ? AND ga.actor_type = ?"
+	} else {
+		q = "DELETE FROM group_actors WHERE actor_id = $2 AND actor_type = $3 AND group_id IN (SELECT id FROM groups WHERE org_id = $1)"
+	}
+	if _, err := dbh.Exec(q, org.ID, act.GetName(), actorTypeOf(act)); err != nil {
+		return util.CastErr(err)
+	}
+	return nil
+}
+
+// seekActorSQL answers the same question SeekActor does -- is actr a member
+// of g, directly or transitively through nested groups -- in one query
+// instead of a DFS through in-process objects.
+func (g *Group) seekActorSQL(actr actor.Actor) (bool, util.Gerror) {
+	dbh := datastore.Dbh()
+	var q string
+	if config.Config.UseMySQL {
+		q = `WITH RECURSIVE subgroup_tree AS (
+			SELECT id FROM groups WHERE id = ?
+			UNION
+			SELECT gs.child_id FROM group_subgroups gs
+			JOIN subgroup_tree st ON gs.parent_id = st.id
+		)
+		SELECT EXISTS (
+			SELECT 1 FROM group_actors ga
+			JOIN subgroup_tree st ON ga.group_id = st.id
+			WHERE ga.actor_id = ? AND ga.actor_type = ?
+		)`
+	} else {
+		q = `WITH RECURSIVE subgroup_tree AS (
+			SELECT id FROM groups WHERE id = $1
+			UNION
+			SELECT gs.child_id FROM group_subgroups gs
+			JOIN subgroup_tree st ON gs.parent_id = st.id
+		)
+		SELECT EXISTS (
+			SELECT 1 FROM group_actors ga
+			JOIN subgroup_tree st ON ga.group_id = st.id
+			WHERE ga.actor_id = $2 AND ga.actor_type = $3
+		)`
+	}
+	var found bool
+	if err := dbh.QueryRow(q, g.id, actr.GetName(), actorTypeOf(actr)).Scan(&found); err != nil {
+		return false, util.CastErr(err)
+	}
+	return found, nil
+}